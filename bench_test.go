@@ -0,0 +1,73 @@
+package matcher
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustCompileForBench(b *testing.B, expr string) *Regexp {
+	b.Helper()
+	re, err := Compile(expr)
+	if err != nil {
+		b.Fatalf("Compile(%q): %v", expr, err)
+	}
+	return re
+}
+
+// The four benchmarks below drive MatchString, which calls Match
+// directly with no submatch tracking: that's the path the DFA-cache
+// and explicit-stack redesign actually targets. Each pattern is
+// anchored to match the whole of x, since Match (unlike FindString)
+// doesn't search for a substring.
+
+func BenchmarkLiteral(b *testing.B) {
+	x := strings.Repeat("x", 50) + "y"
+	re := mustCompileForBench(b, "x*y")
+	for i := 0; i < b.N; i++ {
+		if !re.MatchString(x) {
+			b.Fatal("no match")
+		}
+	}
+}
+
+func BenchmarkNotLiteral(b *testing.B) {
+	x := strings.Repeat("x", 50) + "y"
+	re := mustCompileForBench(b, ".*y")
+	for i := 0; i < b.N; i++ {
+		if !re.MatchString(x) {
+			b.Fatal("no match")
+		}
+	}
+}
+
+func BenchmarkMatchClass(b *testing.B) {
+	x := strings.Repeat("xxxx", 20) + "w"
+	re := mustCompileForBench(b, "[abcdwx]+")
+	for i := 0; i < b.N; i++ {
+		if !re.MatchString(x) {
+			b.Fatal("no match")
+		}
+	}
+}
+
+func BenchmarkMatchClass_InRange(b *testing.B) {
+	x := strings.Repeat("xxxx", 20) + "w"
+	re := mustCompileForBench(b, "[a-z]+")
+	for i := 0; i < b.N; i++ {
+		if !re.MatchString(x) {
+			b.Fatal("no match")
+		}
+	}
+}
+
+// BenchmarkReplaceAll exercises submatchAt, not Match: ReplaceAllString
+// needs the matched span's position, which Match's DFA simulation
+// never computes, so it runs the separate thread-based NFA simulation
+// in regexp.go regardless of Match's caching.
+func BenchmarkReplaceAll(b *testing.B) {
+	x := "abcdefghijklmnop"
+	re := mustCompileForBench(b, "[cjp]")
+	for i := 0; i < b.N; i++ {
+		re.ReplaceAllString(x, "?")
+	}
+}
@@ -0,0 +1,113 @@
+package matcher
+
+import (
+	"container/list"
+	"encoding/binary"
+	"sort"
+	"sync"
+)
+
+// DefaultMaxDFAStates is the bound Compile uses when sizing a
+// Regexp's DFACache.
+const DefaultMaxDFAStates = 4096
+
+// DFACache memoizes the dfastate reached for each distinct powerset of
+// NFA states that Match builds up while stepping through a source
+// string, bounded to maxStates entries with least-recently-used
+// eviction. Without a bound, a pathological pattern/input pair can
+// materialize the full 2^n powerset and grow without limit; with one,
+// a long-running service that keeps a Regexp around and matches
+// against it repeatedly has predictable memory use regardless of how
+// long it runs. Evicting an entry doesn't reach into other dfastates
+// that may still point to it through their own transition table: it
+// simply stops being the canonical cache entry for its powerset, so a
+// later lookup for the same powerset builds (and caches) a fresh,
+// nil-filled dfastate in its place.
+type DFACache struct {
+	mu        sync.Mutex
+	maxStates int
+	entries   map[string]*list.Element
+	order     *list.List // front = most recently used
+
+	nstates int // memoized countStates(start), filled in by statesFor on first use
+}
+
+type dfacacheEntry struct {
+	key   string
+	value *dfastate
+}
+
+// NewDFACache returns a DFACache that holds at most maxStates
+// dfastates before evicting the least-recently-used one.
+func NewDFACache(maxStates int) *DFACache {
+	return &DFACache{
+		maxStates: maxStates,
+		entries:   make(map[string]*list.Element),
+		order:     list.New(),
+	}
+}
+
+// statesFor returns the total number of states in the NFA rooted at
+// start, computing and memoizing it via countStates on first use.
+// Callers use this to size per-call scratch buffers (Match's ping-pong
+// lists, submatchAt's visited array) without racing on nstates
+// themselves when the same cache is shared across concurrent callers.
+func (c *DFACache) statesFor(start *state) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.nstates == 0 {
+		c.nstates = countStates(start)
+	}
+	return c.nstates
+}
+
+func (c *DFACache) get(key string) *dfastate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*dfacacheEntry).value
+}
+
+func (c *DFACache) put(key string, d *dfastate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*dfacacheEntry).value = d
+		c.order.MoveToFront(el)
+		return
+	}
+	el := c.order.PushFront(&dfacacheEntry{key: key, value: d})
+	c.entries[key] = el
+	if c.order.Len() > c.maxStates {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*dfacacheEntry).key)
+	}
+}
+
+// keyFor returns a canonical, comparable representation of a powerset
+// of NFA states: the states' ids, sorted so that the same set of
+// states always produces the same key regardless of the order
+// addstate happened to discover them in, packed into a string cheap
+// enough to use as a map key. Keying on the states' identities this
+// way, rather than on the address of whatever slice variable the
+// caller happened to store the powerset in, is what lets dfastates be
+// shared correctly across calls that reach the same powerset through
+// different (possibly reused) backing arrays.
+func keyFor(list []*state) string {
+	ids := make([]int, len(list))
+	for i, s := range list {
+		ids[i] = s.id
+	}
+	sort.Ints(ids)
+	b := make([]byte, len(ids)*binary.MaxVarintLen64)
+	n := 0
+	for _, id := range ids {
+		n += binary.PutVarint(b[n:], int64(id))
+	}
+	return string(b[:n])
+}
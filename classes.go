@@ -0,0 +1,131 @@
+package matcher
+
+import "unicode/utf8"
+
+// classRange is an inclusive range of runes, used as the fallback
+// representation for code points outside the ASCII fast path.
+type classRange struct {
+	lo, hi rune
+}
+
+// class is a compiled character class, such as [a-z0-9_], [^\n], or
+// \d. Runes below 256 are tested against a bitmap, so contains is a
+// handful of instructions for the common ASCII case; runes at or
+// above 256 fall back to a range list. negate inverts the result.
+type class struct {
+	bits   [4]uint64 // one bit per rune 0-255
+	ranges []classRange
+	negate bool
+}
+
+func newClass() *class {
+	return &class{}
+}
+
+func (c *class) add(r rune) {
+	if r >= 0 && r < 256 {
+		c.bits[r>>6] |= 1 << uint(r&63)
+		return
+	}
+	c.ranges = append(c.ranges, classRange{r, r})
+}
+
+func (c *class) addRange(lo, hi rune) {
+	if hi < lo {
+		lo, hi = hi, lo
+	}
+	if lo < 256 {
+		bitHi := hi
+		if bitHi > 255 {
+			bitHi = 255
+		}
+		for b := lo; b <= bitHi; b++ {
+			c.bits[b>>6] |= 1 << uint(b&63)
+		}
+		if hi <= 255 {
+			return
+		}
+		lo = 256
+	}
+	c.ranges = append(c.ranges, classRange{lo, hi})
+}
+
+// merge adds every rune matched by o into c, honoring o's own
+// negation. The only classes ever merged this way are the Perl
+// shorthands below, whose own (pre-negation) ranges are always ASCII:
+// a negated o therefore matches every rune 256 and above
+// unconditionally, since nothing in o.ranges excludes any of them.
+// That's recorded as a single open-ended range rather than expanding
+// a bitmap, so [\D], [\W], and [\S] agree with the un-bracketed \D,
+// \W, \S on runes outside ASCII instead of silently clamping to it.
+func (c *class) merge(o *class) {
+	for b := rune(0); b < 256; b++ {
+		if o.contains(b) {
+			c.add(b)
+		}
+	}
+	switch {
+	case !o.negate:
+		c.ranges = append(c.ranges, o.ranges...)
+	case len(o.ranges) == 0:
+		c.ranges = append(c.ranges, classRange{256, utf8.MaxRune})
+	default:
+		// Not reached by any class this package builds: a negated o
+		// with its own high ranges would need per-range exclusions
+		// above 255, which no Perl shorthand requires.
+		panic("matcher: merge of a negated class with non-ASCII ranges is unsupported")
+	}
+}
+
+func (c *class) contains(r rune) bool {
+	var in bool
+	if r >= 0 && r < 256 {
+		in = c.bits[r>>6]&(1<<uint(r&63)) != 0
+	} else {
+		for _, rg := range c.ranges {
+			if r >= rg.lo && r <= rg.hi {
+				in = true
+				break
+			}
+		}
+	}
+	if c.negate {
+		return !in
+	}
+	return in
+}
+
+// rangeClass builds a class from a list of inclusive [lo, hi] ranges.
+func rangeClass(ranges ...[2]rune) *class {
+	c := newClass()
+	for _, r := range ranges {
+		c.addRange(r[0], r[1])
+	}
+	return c
+}
+
+// negated returns a copy of c with its sense inverted, for deriving
+// \D, \W, and \S from \d, \w, and \s.
+func negated(c *class) *class {
+	n := *c
+	n.negate = !n.negate
+	return &n
+}
+
+var (
+	classDigit = rangeClass([2]rune{'0', '9'})
+	classWord  = rangeClass([2]rune{'a', 'z'}, [2]rune{'A', 'Z'}, [2]rune{'0', '9'}, [2]rune{'_', '_'})
+	classSpace = rangeClass([2]rune{' ', ' '}, [2]rune{'\t', '\t'}, [2]rune{'\n', '\n'}, [2]rune{'\v', '\v'}, [2]rune{'\f', '\f'}, [2]rune{'\r', '\r'})
+)
+
+// perlClasses maps the Perl shorthands \d \D \w \W \s \S to their
+// compiled class. They are valid both inside and outside a bracket
+// expression.
+var perlClasses = map[rune]*class{
+	'd': classDigit,
+	'D': negated(classDigit),
+	'w': classWord,
+	'W': negated(classWord),
+	's': classSpace,
+	'S': negated(classSpace),
+}
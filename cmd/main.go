@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"log"
 	"os"
 
 	"github.com/smasher164/matcher"
@@ -17,8 +18,12 @@ func main() {
 		os.Exit(1)
 	}
 
-	chars := matcher.Lex(regexp)
+	chars, err := matcher.Lex(regexp)
+	if err != nil {
+		log.Fatalln(err)
+	}
 	chars = matcher.Postfix(chars)
 	nfa := matcher.Post2nfa(chars)
-	fmt.Println(matcher.Match(nfa, source))
+	cache := matcher.NewDFACache(matcher.DefaultMaxDFAStates)
+	fmt.Println(matcher.Match(nfa, source, cache))
 }
@@ -0,0 +1,21 @@
+package matcher
+
+import "errors"
+
+// Parse errors returned by Lex when an expression is malformed.
+var (
+	// ErrUnmatchedLpar is returned when a '(' has no matching ')', or
+	// a ')' appears with no preceding '('.
+	ErrUnmatchedLpar = errors.New("matcher: unmatched '('")
+	// ErrBadClosure is returned when '*', '+', or '?' follows a token
+	// that cannot be repeated, such as '|' or another repeat operator.
+	ErrBadClosure = errors.New("matcher: invalid repeat operator")
+	// ErrBareClosure is returned when '*', '+', or '?' appears with no
+	// preceding token to repeat.
+	ErrBareClosure = errors.New("matcher: repeat operator has nothing to repeat")
+	// ErrTrailingBackslash is returned when an expression ends in an
+	// unescaped '\'.
+	ErrTrailingBackslash = errors.New("matcher: trailing backslash in expression")
+	// ErrUnmatchedLbracket is returned when a '[' has no matching ']'.
+	ErrUnmatchedLbracket = errors.New("matcher: unmatched '['")
+)
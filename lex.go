@@ -1,8 +1,8 @@
-package main
+package matcher
 
 import (
 	"fmt"
-	"log"
+	"unicode/utf8"
 )
 
 const (
@@ -10,7 +10,16 @@ const (
 	charEscapeLiteral
 	charLiteral
 	charDot
+	charBOL
+	charEOL
+	charLparen
+	charRparen
+	charClass
+	charCapStart // zero-width: start of a capture group, emitted by annotateCaptures
+	charCapEnd   // zero-width: end of a capture group, emitted by annotateCaptures
 	charStar
+	charPlus
+	charQuestion
 	charConcat
 	charOr
 )
@@ -19,38 +28,125 @@ const (
 type charType int
 
 type char struct {
-	typ charType
-	val byte
+	typ   charType
+	val   rune
+	cls   *class // set only when typ == charClass
+	group int    // capture group index; set only when typ == charCapStart or charCapEnd
 }
 
 func (c char) String() string {
-	return fmt.Sprintf("{%s %q}", c.typ, c.val)
+	switch c.typ {
+	case charClass:
+		return fmt.Sprintf("{%v %v}", c.typ, *c.cls)
+	case charCapStart, charCapEnd:
+		return fmt.Sprintf("{%v group=%d}", c.typ, c.group)
+	}
+	return fmt.Sprintf("{%v %q}", c.typ, c.val)
 }
 
+// lexer scans expression one rune at a time. pos is the byte offset
+// of the next unread rune; peek/peek2/advance never split a
+// multi-byte rune.
 type lexer struct {
 	expression string
 	pos        int
 	chars      []char
+	depth      int
+}
+
+// peek returns the rune at pos without consuming it.
+func (l *lexer) peek() (rune, bool) {
+	if l.pos >= len(l.expression) {
+		return 0, false
+	}
+	r, _ := utf8.DecodeRuneInString(l.expression[l.pos:])
+	return r, true
 }
 
-func (l *lexer) run() {
+// peek2 returns the rune following the one at pos, a one-token
+// lookahead used for escapes and ranges.
+func (l *lexer) peek2() (rune, bool) {
+	if l.pos >= len(l.expression) {
+		return 0, false
+	}
+	_, size := utf8.DecodeRuneInString(l.expression[l.pos:])
+	if l.pos+size >= len(l.expression) {
+		return 0, false
+	}
+	r, _ := utf8.DecodeRuneInString(l.expression[l.pos+size:])
+	return r, true
+}
+
+// advance consumes and returns the rune at pos.
+func (l *lexer) advance() rune {
+	r, size := utf8.DecodeRuneInString(l.expression[l.pos:])
+	l.pos += size
+	return r
+}
+
+func (l *lexer) run() error {
 	for {
-		switch l.expression[l.pos] {
+		r, ok := l.peek()
+		if !ok {
+			break
+		}
+		var err error
+		switch r {
 		case '\\':
-			l.emit(charEscapeLiteral)
+			if nr, ok := l.peek2(); ok {
+				if cls, ok := perlClasses[nr]; ok {
+					l.advance()
+					l.advance()
+					err = l.emitClass(cls)
+					break
+				}
+			}
+			err = l.emitEscape()
 		case '.':
-			l.emit(charDot)
+			l.advance()
+			err = l.emit(charDot, r)
+		case '^':
+			l.advance()
+			err = l.emit(charBOL, r)
+		case '$':
+			l.advance()
+			err = l.emit(charEOL, r)
+		case '(':
+			l.advance()
+			err = l.emit(charLparen, r)
+		case ')':
+			l.advance()
+			err = l.emit(charRparen, r)
+		case '[':
+			var cls *class
+			cls, err = l.parseBracket()
+			if err == nil {
+				err = l.emitClass(cls)
+			}
 		case '*':
-			l.emit(charStar)
+			l.advance()
+			err = l.emit(charStar, r)
+		case '+':
+			l.advance()
+			err = l.emit(charPlus, r)
+		case '?':
+			l.advance()
+			err = l.emit(charQuestion, r)
 		case '|':
-			l.emit(charOr)
+			l.advance()
+			err = l.emit(charOr, r)
 		default:
-			l.emit(charLiteral)
+			l.advance()
+			err = l.emit(charLiteral, r)
 		}
-		if !l.next() {
-			break
+		if err != nil {
+			return err
 		}
 	}
+	if l.depth != 0 {
+		return ErrUnmatchedLpar
+	}
+	return nil
 }
 
 func (l *lexer) top() *char {
@@ -60,31 +156,166 @@ func (l *lexer) top() *char {
 	return nil
 }
 
-// emit validates and appends the concatenated characters
-// to to a slice.
-func (l *lexer) emit(t charType) {
-	c := l.expression[l.pos]
-	if t == charEscapeLiteral {
-		if l.next() {
-			c = escape(l.expression[l.pos])
-		} else {
-			log.Fatalln("cannot have a trailing backslash in regular expression")
-		}
+// isTerm reports whether t can start a term: a literal, a group, or
+// an anchor.
+func isTerm(t charType) bool {
+	switch t {
+	case charLiteral, charEscapeLiteral, charDot, charClass, charLparen, charBOL, charEOL:
+		return true
 	}
+	return false
+}
+
+// isClosure reports whether t is a repetition operator.
+func isClosure(t charType) bool {
+	return t == charStar || t == charPlus || t == charQuestion
+}
+
+// isQuantifiable reports whether t can be the operand of a repetition
+// operator.
+func isQuantifiable(t charType) bool {
+	switch t {
+	case charLiteral, charEscapeLiteral, charDot, charClass, charRparen:
+		return true
+	}
+	return false
+}
+
+// emit validates and appends a token of type t with value v,
+// inserting an implicit concatenation where the grammar requires one.
+func (l *lexer) emit(t charType, v rune) error {
 	top := l.top()
-	if t == charStar {
-		if top == nil || (top.typ != charLiteral && top.typ != charDot) {
-			log.Fatalln("Preceding token to star is not quantifiable")
+	if isClosure(t) {
+		if top == nil {
+			return ErrBareClosure
+		}
+		if !isQuantifiable(top.typ) {
+			return ErrBadClosure
 		}
 	}
-	if t != charStar && t != charOr && (top == nil || top.typ != charOr) {
-		l.chars = append(l.chars, char{charConcat, '.'})
+	if t == charRparen {
+		if l.depth == 0 {
+			return ErrUnmatchedLpar
+		}
+		l.depth--
+	}
+	if t == charLparen {
+		l.depth++
+	}
+	if isTerm(t) && (top == nil || (top.typ != charOr && top.typ != charLparen)) {
+		l.chars = append(l.chars, char{typ: charConcat, val: '.'})
+	}
+	l.chars = append(l.chars, char{typ: t, val: v})
+	return nil
+}
+
+// emitEscape consumes a backslash and the literal it escapes, then
+// emits it as a charEscapeLiteral.
+func (l *lexer) emitEscape() error {
+	l.advance() // '\\'
+	r, ok := l.peek()
+	if !ok {
+		return ErrTrailingBackslash
 	}
-	l.chars = append(l.chars, char{t, c})
+	l.advance()
+	return l.emit(charEscapeLiteral, escape(r))
 }
 
-func escape(c byte) byte {
-	switch c {
+// emitClass appends a charClass token, applying the same implicit
+// concatenation rule as emit.
+func (l *lexer) emitClass(cls *class) error {
+	top := l.top()
+	if top == nil || (top.typ != charOr && top.typ != charLparen) {
+		l.chars = append(l.chars, char{typ: charConcat, val: '.'})
+	}
+	l.chars = append(l.chars, char{typ: charClass, cls: cls})
+	return nil
+}
+
+// classItem is one element parsed out of a bracket expression: either
+// a single rune (r) or, when a Perl shorthand like \d is found, the
+// class it expands to.
+type classItem struct {
+	r   rune
+	cls *class
+}
+
+// nextClassItem consumes and returns the next item inside a bracket
+// expression.
+func (l *lexer) nextClassItem() (classItem, error) {
+	r, ok := l.peek()
+	if !ok {
+		return classItem{}, ErrUnmatchedLbracket
+	}
+	if r != '\\' {
+		l.advance()
+		return classItem{r: r}, nil
+	}
+	l.advance() // '\\'
+	esc, ok := l.peek()
+	if !ok {
+		return classItem{}, ErrTrailingBackslash
+	}
+	l.advance()
+	if pc, ok := perlClasses[esc]; ok {
+		return classItem{cls: pc}, nil
+	}
+	return classItem{r: escape(esc)}, nil
+}
+
+// parseBracket parses a bracket expression such as [a-z0-9_] or
+// [^\n], starting with pos at the opening '['. On return, pos is
+// just past the closing ']'.
+func (l *lexer) parseBracket() (*class, error) {
+	cls := newClass()
+	l.advance() // '['
+	if r, ok := l.peek(); ok && r == '^' {
+		cls.negate = true
+		l.advance()
+	}
+	first := true
+	for {
+		r, ok := l.peek()
+		if !ok {
+			return nil, ErrUnmatchedLbracket
+		}
+		if r == ']' && !first {
+			l.advance()
+			return cls, nil
+		}
+		first = false
+		lo, err := l.nextClassItem()
+		if err != nil {
+			return nil, err
+		}
+		if lo.cls != nil {
+			cls.merge(lo.cls)
+			continue
+		}
+		hi := lo.r
+		if dash, ok := l.peek(); ok && dash == '-' {
+			if nr, ok := l.peek2(); ok && nr != ']' {
+				l.advance() // '-'
+				hiItem, err := l.nextClassItem()
+				if err != nil {
+					return nil, err
+				}
+				if hiItem.cls != nil {
+					// A Perl class can't be a range endpoint; take the
+					// '-' literally and merge the class on its own.
+					cls.add('-')
+					cls.merge(hiItem.cls)
+					continue
+				}
+				hi = hiItem.r
+			}
+		}
+		cls.addRange(lo.r, hi)
+	}
+}
+
+func escape(r rune) rune {
+	switch r {
 	case '0':
 		return '\x00'
 	case 'a':
@@ -106,39 +337,57 @@ func escape(c byte) byte {
 	case '\\':
 		return '\x5C'
 	default:
-		return c
-	}
-}
-
-func (l *lexer) next() bool {
-	l.pos++
-	if l.pos < len(l.expression) {
-		return true
+		return r
 	}
-	return false
 }
 
-// lex parses the input regular expression, and returns
-// a sequence of concatenated character tokens.
-func lex(expression string) []char {
+// Lex parses the input regular expression, and returns
+// a sequence of concatenated character tokens. It returns
+// ErrUnmatchedLpar, ErrUnmatchedLbracket, ErrBadClosure,
+// ErrBareClosure, or ErrTrailingBackslash if expression is malformed.
+func Lex(expression string) ([]char, error) {
 	if len(expression) == 0 {
-		return []char{}
+		return []char{}, nil
 	}
 	l := &lexer{
 		expression: expression,
 		chars:      make([]char, 0, len(expression)),
 	}
-	l.run()
-	return l.chars[1:]
+	if err := l.run(); err != nil {
+		return nil, err
+	}
+	// emit only prepends the placeholder charConcat (value '.') when
+	// the very first token it sees is a term; a pattern that starts
+	// with something else (e.g. a leading '|') never gets one, so it
+	// can't be assumed to always be there to strip.
+	if len(l.chars) > 0 && l.chars[0].typ == charConcat {
+		return l.chars[1:], nil
+	}
+	return l.chars, nil
 }
 
-// postfix converts a sequence of character tokens
-// into postfix format. For instance, in order of
-// highest to lowest precedence:
+// precedence ranks operators for the shunting-yard conversion in
+// Postfix, from lowest to highest binding.
+func precedence(t charType) int {
+	switch t {
+	case charOr:
+		return 1
+	case charConcat:
+		return 2
+	case charStar, charPlus, charQuestion:
+		return 3
+	}
+	return 0
+}
+
+// Postfix converts a sequence of character tokens
+// into postfix format, honoring parenthesized groups.
+// For instance, in order of highest to lowest precedence:
 // A.B*		-->		AB*.
 // A.B.C	-->		AB.C.
 // A.B|C.D	-->		AB.CD.|
-func postfix(chars []char) []char {
+// (A.B)*	-->		AB.*
+func Postfix(chars []char) []char {
 	output := []char{}
 	operator := []char{}
 	pop := func() *char {
@@ -155,22 +404,26 @@ func postfix(chars []char) []char {
 	}
 	for _, c := range chars {
 		switch c.typ {
-		case charStar:
-			if t := top(); t != nil {
-				if t.typ == charStar {
-					output = append(output, *pop())
-				}
-			}
+		case charLparen:
 			operator = append(operator, c)
-		case charConcat:
-			if t := top(); t != nil {
-				if t.typ == charConcat || t.typ == charStar {
-					output = append(output, *pop())
+		case charRparen:
+			for {
+				t := top()
+				if t == nil {
+					break
+				}
+				if t.typ == charLparen {
+					pop()
+					break
 				}
+				output = append(output, *pop())
 			}
-			operator = append(operator, c)
-		case charOr:
-			if t := top(); t != nil {
+		case charStar, charPlus, charQuestion, charConcat, charOr:
+			for {
+				t := top()
+				if t == nil || t.typ == charLparen || precedence(t.typ) < precedence(c.typ) {
+					break
+				}
 				output = append(output, *pop())
 			}
 			operator = append(operator, c)
@@ -11,34 +11,121 @@ func TestLex(t *testing.T) {
 		tokens     []char
 	}{
 		{`abc`, []char{
-			{charLiteral, 'a'},
-			{charConcat, '.'},
-			{charLiteral, 'b'},
-			{charConcat, '.'},
-			{charLiteral, 'c'},
+			{typ: charLiteral, val: 'a'},
+			{typ: charConcat, val: '.'},
+			{typ: charLiteral, val: 'b'},
+			{typ: charConcat, val: '.'},
+			{typ: charLiteral, val: 'c'},
 		}},
 		{`.*c`, []char{
-			{charDot, '.'},
-			{charStar, '*'},
-			{charConcat, '.'},
-			{charLiteral, 'c'},
+			{typ: charDot, val: '.'},
+			{typ: charStar, val: '*'},
+			{typ: charConcat, val: '.'},
+			{typ: charLiteral, val: 'c'},
 		}},
 		{`a|b`, []char{
-			{charLiteral, 'a'},
-			{charOr, '|'},
-			{charLiteral, 'b'},
+			{typ: charLiteral, val: 'a'},
+			{typ: charOr, val: '|'},
+			{typ: charLiteral, val: 'b'},
 		}},
 		{`\.ac`, []char{
-			{charEscapeLiteral, '.'},
-			{charConcat, '.'},
-			{charLiteral, 'a'},
-			{charConcat, '.'},
-			{charLiteral, 'c'},
+			{typ: charEscapeLiteral, val: '.'},
+			{typ: charConcat, val: '.'},
+			{typ: charLiteral, val: 'a'},
+			{typ: charConcat, val: '.'},
+			{typ: charLiteral, val: 'c'},
+		}},
+		{`a+`, []char{
+			{typ: charLiteral, val: 'a'},
+			{typ: charPlus, val: '+'},
+		}},
+		{`a?`, []char{
+			{typ: charLiteral, val: 'a'},
+			{typ: charQuestion, val: '?'},
+		}},
+		{`(ab)*`, []char{
+			{typ: charLparen, val: '('},
+			{typ: charLiteral, val: 'a'},
+			{typ: charConcat, val: '.'},
+			{typ: charLiteral, val: 'b'},
+			{typ: charRparen, val: ')'},
+			{typ: charStar, val: '*'},
+		}},
+		{`^a$`, []char{
+			{typ: charBOL, val: '^'},
+			{typ: charConcat, val: '.'},
+			{typ: charLiteral, val: 'a'},
+			{typ: charConcat, val: '.'},
+			{typ: charEOL, val: '$'},
+		}},
+		{`|ab`, []char{
+			{typ: charOr, val: '|'},
+			{typ: charLiteral, val: 'a'},
+			{typ: charConcat, val: '.'},
+			{typ: charLiteral, val: 'b'},
 		}},
 	}
 
 	for i, c := range cases {
-		chars := Lex(c.expression)
+		chars, err := Lex(c.expression)
+		if err != nil {
+			t.Fatalf("case: %v, unexpected error: %v", i, err)
+		}
+		if !reflect.DeepEqual(c.tokens, chars) {
+			t.Fatalf("case: %v, got: %v, wanted: %v", i, chars, c)
+		}
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	cases := []struct {
+		expression string
+		err        error
+	}{
+		{`(a`, ErrUnmatchedLpar},
+		{`a)`, ErrUnmatchedLpar},
+		{`*a`, ErrBareClosure},
+		{`a**`, ErrBadClosure},
+		{`a|*`, ErrBadClosure},
+		{`a\`, ErrTrailingBackslash},
+		{`[a-z`, ErrUnmatchedLbracket},
+	}
+
+	for i, c := range cases {
+		_, err := Lex(c.expression)
+		if err != c.err {
+			t.Fatalf("case: %v, got err: %v, wanted: %v", i, err, c.err)
+		}
+	}
+}
+
+func TestLexClass(t *testing.T) {
+	cases := []struct {
+		expression string
+		tokens     []char
+	}{
+		{`[abc]`, []char{
+			{typ: charClass, cls: rangeClass([2]rune{'a', 'a'}, [2]rune{'b', 'b'}, [2]rune{'c', 'c'})},
+		}},
+		{`[a-z]`, []char{
+			{typ: charClass, cls: rangeClass([2]rune{'a', 'z'})},
+		}},
+		{`[^a-z]`, []char{
+			{typ: charClass, cls: negated(rangeClass([2]rune{'a', 'z'}))},
+		}},
+		{`\d`, []char{
+			{typ: charClass, cls: classDigit},
+		}},
+		{`[\d_]`, []char{
+			{typ: charClass, cls: rangeClass([2]rune{'0', '9'}, [2]rune{'_', '_'})},
+		}},
+	}
+
+	for i, c := range cases {
+		chars, err := Lex(c.expression)
+		if err != nil {
+			t.Fatalf("case: %v, unexpected error: %v", i, err)
+		}
 		if !reflect.DeepEqual(c.tokens, chars) {
 			t.Fatalf("case: %v, got: %v, wanted: %v", i, chars, c)
 		}
@@ -51,53 +138,79 @@ func TestPostfix(t *testing.T) {
 		postfix []char
 	}{
 		{[]char{
-			{charLiteral, 'a'},
-			{charConcat, '.'},
-			{charLiteral, 'b'},
-			{charConcat, '.'},
-			{charLiteral, 'c'},
+			{typ: charLiteral, val: 'a'},
+			{typ: charConcat, val: '.'},
+			{typ: charLiteral, val: 'b'},
+			{typ: charConcat, val: '.'},
+			{typ: charLiteral, val: 'c'},
+		}, []char{
+			{typ: charLiteral, val: 'a'},
+			{typ: charLiteral, val: 'b'},
+			{typ: charConcat, val: '.'},
+			{typ: charLiteral, val: 'c'},
+			{typ: charConcat, val: '.'},
+		}},
+
+		{[]char{
+			{typ: charDot, val: '.'},
+			{typ: charStar, val: '*'},
+			{typ: charConcat, val: '.'},
+			{typ: charLiteral, val: 'c'},
+		}, []char{
+			{typ: charDot, val: '.'},
+			{typ: charStar, val: '*'},
+			{typ: charLiteral, val: 'c'},
+			{typ: charConcat, val: '.'},
+		}},
+
+		{[]char{
+			{typ: charLiteral, val: 'a'},
+			{typ: charOr, val: '|'},
+			{typ: charLiteral, val: 'b'},
 		}, []char{
-			{charLiteral, 'a'},
-			{charLiteral, 'b'},
-			{charConcat, '.'},
-			{charLiteral, 'c'},
-			{charConcat, '.'},
+			{typ: charLiteral, val: 'a'},
+			{typ: charLiteral, val: 'b'},
+			{typ: charOr, val: '|'},
 		}},
 
 		{[]char{
-			{charDot, '.'},
-			{charStar, '*'},
-			{charConcat, '.'},
-			{charLiteral, 'c'},
+			{typ: charEscapeLiteral, val: '.'},
+			{typ: charConcat, val: '.'},
+			{typ: charLiteral, val: 'a'},
+			{typ: charConcat, val: '.'},
+			{typ: charLiteral, val: 'c'},
 		}, []char{
-			{charDot, '.'},
-			{charStar, '*'},
-			{charLiteral, 'c'},
-			{charConcat, '.'},
+			{typ: charEscapeLiteral, val: '.'},
+			{typ: charLiteral, val: 'a'},
+			{typ: charConcat, val: '.'},
+			{typ: charLiteral, val: 'c'},
+			{typ: charConcat, val: '.'},
 		}},
 
 		{[]char{
-			{charLiteral, 'a'},
-			{charOr, '|'},
-			{charLiteral, 'b'},
+			{typ: charLparen, val: '('},
+			{typ: charLiteral, val: 'a'},
+			{typ: charConcat, val: '.'},
+			{typ: charLiteral, val: 'b'},
+			{typ: charRparen, val: ')'},
+			{typ: charStar, val: '*'},
 		}, []char{
-			{charLiteral, 'a'},
-			{charLiteral, 'b'},
-			{charOr, '|'},
+			{typ: charLiteral, val: 'a'},
+			{typ: charLiteral, val: 'b'},
+			{typ: charConcat, val: '.'},
+			{typ: charStar, val: '*'},
 		}},
 
 		{[]char{
-			{charEscapeLiteral, '.'},
-			{charConcat, '.'},
-			{charLiteral, 'a'},
-			{charConcat, '.'},
-			{charLiteral, 'c'},
+			{typ: charLiteral, val: 'a'},
+			{typ: charConcat, val: '.'},
+			{typ: charLiteral, val: 'b'},
+			{typ: charPlus, val: '+'},
 		}, []char{
-			{charEscapeLiteral, '.'},
-			{charLiteral, 'a'},
-			{charConcat, '.'},
-			{charLiteral, 'c'},
-			{charConcat, '.'},
+			{typ: charLiteral, val: 'a'},
+			{typ: charLiteral, val: 'b'},
+			{typ: charPlus, val: '+'},
+			{typ: charConcat, val: '.'},
 		}},
 	}
 
@@ -18,11 +18,25 @@ https://youtu.be/HxaD_trXwRE
 		c	matches any literal character c
 		.	matches any single character
 		*	matches zero or more occurrences of the previous character
+		+	matches one or more occurrences of the previous character
+		?	matches zero or one occurrence of the previous character
 		|	matches the previous character or the next character
+		(e)	matches e, grouping it into a single term
+		^	matches the beginning of the source
+		$	matches the end of the source
+		[...]	matches any one character in the class, e.g. [a-z0-9_]
+		[^...]	matches any one character not in the class
+		\d \w \s	matches a digit, word, or whitespace character
+		\D \W \S	the negation of \d, \w, \s
 */
 package matcher
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
 
 //go:generate stringer -type=styp
 type styp int
@@ -31,19 +45,23 @@ const (
 	match styp = iota
 	split
 	single
+	stypBOL  // zero-width assertion: beginning of source
+	stypEOL  // zero-width assertion: end of source
+	stypSave // zero-width: records the current position into slot
 )
 
 // A state represents a single node in the nondeterministic finite
 // automaton (NFA).
 type state struct {
-	typ      styp     // the type of the state
-	c        char     // token that the state represents
-	out      []*state // pointers to the next state(s)
-	lastlist int      // allows partial scanning of the state lists
+	typ  styp     // the type of the state
+	c    char     // token that the state represents
+	out  []*state // pointers to the next state(s)
+	slot int      // capture slot recorded on a stypSave state
+	id   int      // unique within this NFA; used both as a dfastate cache key and to index a caller-owned visited set
 }
 
 func (s state) String() string {
-	return fmt.Sprintf("{typ: %s, c: %s, out: %p}", s.typ, s.c, s.out)
+	return fmt.Sprintf("{typ: %v, c: %v, out: %p}", s.typ, s.c, s.out)
 }
 
 // A frag represents an NFA fragment, used to compile the postfix
@@ -68,16 +86,53 @@ func (p ptr) String() string {
 }
 
 // A dfastate is a cached list of states, containing pointers to
-// dfastates for each possible character
+// dfastates for each possible next rune. ASCII runes, the overwhelming
+// common case, are stored in a flat array; anything else falls back
+// to a sparse map so the struct doesn't pay for the full Unicode
+// range up front. list is a stable copy owned by this dfastate, not a
+// view into Match's scratch buffers, so it stays valid after those
+// buffers are reused for a later step.
 type dfastate struct {
-	list *[]*state
-	next [256]*dfastate
+	mu    sync.RWMutex
+	list  []*state
+	next  [128]*dfastate
+	extra map[rune]*dfastate
+}
+
+// get and set are called from every Match on a shared *dfastate handed
+// out by the DFACache, so they lock around next/extra: extra in
+// particular is a plain map, and concurrent unsynchronized writes to
+// it would risk a runtime "concurrent map writes" panic, not merely a
+// race.
+func (d *dfastate) get(r rune) *dfastate {
+	if r >= 0 && r < 128 {
+		d.mu.RLock()
+		nd := d.next[r]
+		d.mu.RUnlock()
+		return nd
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.extra == nil {
+		return nil
+	}
+	return d.extra[r]
 }
 
-// cacheddfa is a map that is keyed by pointers to
-// a list of states, with the corresponding value of
-// a dfastate. Avoids recomputation of each powerset.
-var cacheddfa map[*[]*state]*dfastate
+func (d *dfastate) set(r rune, nd *dfastate) {
+	if r >= 0 && r < 128 {
+		d.mu.Lock()
+		d.next[r] = nd
+		d.mu.Unlock()
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.extra == nil {
+		d.extra = make(map[rune]*dfastate)
+	}
+	d.extra[r] = nd
+}
 
 // patch connects the arrows from out to the state start.
 func patch(out []ptr, start *state) {
@@ -93,6 +148,11 @@ func patch(out []ptr, start *state) {
 // and uses a stack of fragments to construct a
 // single nfa fragment representing the state machine.
 func Post2nfa(postfix []char) (start *state) {
+	var nextID int
+	newID := func() int {
+		nextID++
+		return nextID
+	}
 	stack := []frag{}
 	push := func(f frag) {
 		stack = append(stack, f)
@@ -104,7 +164,21 @@ func Post2nfa(postfix []char) (start *state) {
 	for _, p := range postfix {
 		switch p.typ {
 		default:
-			s := &state{typ: single, c: p, out: []*state{nil}}
+			typ := single
+			slot := -1
+			switch p.typ {
+			case charBOL:
+				typ = stypBOL
+			case charEOL:
+				typ = stypEOL
+			case charCapStart:
+				typ = stypSave
+				slot = 2 * p.group
+			case charCapEnd:
+				typ = stypSave
+				slot = 2*p.group + 1
+			}
+			s := &state{typ: typ, c: p, out: []*state{nil}, slot: slot, id: newID()}
 			out := []ptr{{s, 0}}
 			push(frag{s, out})
 		case charConcat:
@@ -114,85 +188,232 @@ func Post2nfa(postfix []char) (start *state) {
 			push(frag{e1.start, e2.out})
 		case charStar:
 			e := pop()
-			s := &state{typ: split, out: []*state{e.start, nil}}
+			s := &state{typ: split, out: []*state{e.start, nil}, id: newID()}
 			patch(e.out, s)
 			out := []ptr{{s, 1}}
 			push(frag{s, out})
+		case charPlus:
+			e := pop()
+			s := &state{typ: split, out: []*state{e.start, nil}, id: newID()}
+			patch(e.out, s)
+			out := []ptr{{s, 1}}
+			push(frag{e.start, out})
+		case charQuestion:
+			e := pop()
+			s := &state{typ: split, out: []*state{e.start, nil}, id: newID()}
+			out := append([]ptr{{s, 1}}, e.out...)
+			push(frag{s, out})
 		case charOr:
 			e2 := pop()
 			e1 := pop()
-			s := &state{typ: split, out: []*state{e1.start, e2.start}}
+			s := &state{typ: split, out: []*state{e1.start, e2.start}, id: newID()}
 			out := append(e1.out, e2.out...)
 			push(frag{s, out})
 		}
 	}
 	e := pop()
-	patch(e.out, &state{typ: match})
+	patch(e.out, &state{typ: match, id: newID()})
 	return e.start
 }
 
-// addstate a new unique state to the list, following
-// any unlabeled arrows along the way.
-func addstate(list *[]*state, s *state, listid int) {
-	if s.lastlist == listid {
-		return
+// addstate adds a new unique state to the list, following any
+// unlabeled arrows along the way. atBOL and atEOL report whether the
+// current source position is the beginning or end of the source,
+// respectively, and gate whether a stypBOL/stypEOL assertion may be
+// followed. visited and gen dedup states already added during the
+// current pass: visited[s.id] == gen means s was already seen. Both
+// are owned by the caller (one Match or submatchAt call), never
+// shared across calls, so that the same compiled NFA can be driven by
+// multiple goroutines at once without synchronizing on its states. It
+// walks the chain of splits/assertions/saves with an explicit stack
+// rather than recursion, since this runs once per rune of input and a
+// long chain of splits (e.g. from a deeply nested closure) shouldn't
+// grow the Go call stack.
+func addstate(list *[]*state, s *state, visited []int, gen int, atBOL, atEOL bool) {
+	stack := []*state{s}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited[s.id] == gen {
+			continue
+		}
+		visited[s.id] = gen
+		switch s.typ {
+		case split:
+			// out[1] is pushed first so out[0], the higher-priority
+			// branch, is popped (and so fully explored) first.
+			stack = append(stack, s.out[1], s.out[0])
+		case stypBOL:
+			if atBOL {
+				stack = append(stack, s.out[0])
+			}
+		case stypEOL:
+			if atEOL {
+				stack = append(stack, s.out[0])
+			}
+		case stypSave:
+			stack = append(stack, s.out[0])
+		default:
+			*list = append(*list, s)
+		}
 	}
-	s.lastlist = listid
-	if s.typ == split {
-		addstate(list, s.out[0], listid)
-		addstate(list, s.out[1], listid)
-		return
+}
+
+// countStates returns the number of distinct states reachable from
+// start, used to size Match's preallocated scratch buffers: no single
+// step can ever produce a powerset larger than the whole NFA.
+func countStates(start *state) int {
+	seen := map[*state]bool{}
+	var walk func(s *state)
+	walk = func(s *state) {
+		if s == nil || seen[s] {
+			return
+		}
+		seen[s] = true
+		for _, o := range s.out {
+			walk(o)
+		}
 	}
-	*list = append(*list, s)
+	walk(start)
+	return len(seen)
 }
 
-// Match loops through the source input, and
-// steps through the state machine. Returns true
-// if there is a match, false if not.
-func Match(start *state, source string) bool {
-	cacheddfa = make(map[*[]*state]*dfastate)
+// literalPrefix returns the fixed literal run, if any, that every
+// match starting at start must begin with. It walks the chain of
+// single-successor states at the head of the NFA, passing
+// transparently through zero-width stypSave/stypBOL states, and stops
+// at the first state that isn't a plain literal (a split, a
+// character class, '.', and so on). It is purely a pre-filter: Match
+// always runs the full simulation regardless, so an imprecise (too
+// short, or empty) prefix only costs a missed fast-reject, never a
+// wrong answer.
+func literalPrefix(start *state) string {
+	var b strings.Builder
+	for s := start; s != nil; {
+		switch s.typ {
+		case stypSave, stypBOL:
+			s = s.out[0]
+			continue
+		case single:
+			if s.c.typ == charLiteral || s.c.typ == charEscapeLiteral {
+				b.WriteRune(s.c.val)
+				s = s.out[0]
+				continue
+			}
+		}
+		break
+	}
+	return b.String()
+}
 
-	listid := 1
-	list := []*state{}
-	addstate(&list, start, listid)
-	d := getdfastate(&list)
-	var next *dfastate
+// Match loops through the source input one rune at a time, and steps
+// through the state machine. Returns true if there is a match, false
+// if not. cache memoizes the dfastate for each distinct powerset of
+// NFA states reached; pass the same cache across calls against the
+// same compiled pattern to amortize DFA construction, or a fresh one
+// per call for isolation. Match is safe to call concurrently, even
+// with the same start and cache: it never mutates shared NFA state,
+// keeping its own visited/gen bookkeeping local to the call, and
+// cache and the dfastates it hands out guard their own mutable state.
+func Match(start *state, source string, cache *DFACache) bool {
+	if prefix := literalPrefix(start); prefix != "" && !strings.HasPrefix(source, prefix) {
+		return false
+	}
+
+	// scratch ping-pongs between two buffers, preallocated once to the
+	// NFA's total state count (an upper bound on any single powerset),
+	// so step doesn't allocate a fresh []*state on every rune. Each
+	// computed powerset is handed to getdfastate, which takes its own
+	// stable copy before scratch is reused for the next rune.
+	nstates := cache.statesFor(start)
+	var scratch [2][]*state
+	scratch[0] = make([]*state, 0, nstates)
+	scratch[1] = make([]*state, 0, nstates)
+	cur := 0
 
-	for i := range source {
-		c := source[i]
-		next = d.next[c]
+	// visited/gen replace a shared per-state "lastlist" marker: they're
+	// allocated fresh for this call and never touched by any other
+	// goroutine, so concurrent Match calls sharing start and cache
+	// don't race on NFA state.
+	visited := make([]int, nstates+1)
+	gen := 1
+	addstate(&scratch[cur], start, visited, gen, true, len(source) == 0)
+	d := getdfastate(scratch[cur], cache)
+	list := d.list
+
+	for i := 0; i < len(source); {
+		r, size := utf8.DecodeRuneInString(source[i:])
+		atEOL := i+size == len(source)
+		if atEOL {
+			// The final transition is never cached: d.next/d.extra are
+			// keyed only by rune, so a dfastate reached earlier at a
+			// non-final position (e.g. inside a loop) could otherwise
+			// be replayed here with a stale stypEOL decision.
+			cur ^= 1
+			gen++
+			stepped := step(scratch[cur][:0], list, r, visited, gen, true)
+			d = getdfastate(stepped, cache)
+			list = d.list
+			i += size
+			continue
+		}
+		next := d.get(r)
 		if next == nil {
-			list, listid = step(list, c, listid)
-			d.next[c] = getdfastate(&list)
-			next = d.next[c]
+			cur ^= 1
+			gen++
+			stepped := step(scratch[cur][:0], list, r, visited, gen, false)
+			next = getdfastate(stepped, cache)
+			d.set(r, next)
 		}
 		d = next
+		list = d.list
+		i += size
 	}
-	return ismatch(*d.list)
+	return ismatch(list)
 }
 
-// step computes the next list of states for a single character
-func step(list []*state, c byte, listid int) ([]*state, int) {
-	nlist := []*state{}
-	listid++
+// step appends to dst the next list of states reached from list on
+// rune r, following zero-width states along the way. dst is expected
+// to be an empty, pre-sized scratch buffer owned by the caller; step
+// never retains it past the call. visited and gen are the caller's
+// per-call dedup bookkeeping, as in addstate.
+func step(dst, list []*state, r rune, visited []int, gen int, atEOL bool) []*state {
 	for _, s := range list {
-		if s.typ == single && s.c.val == c || s.c.typ == charDot {
-			addstate(&nlist, s.out[0], listid)
+		if matchesChar(s, r) {
+			addstate(&dst, s.out[0], visited, gen, false, atEOL)
 		}
 	}
-	return nlist, listid
+	return dst
+}
+
+// matchesChar reports whether the consuming state s accepts r.
+func matchesChar(s *state, r rune) bool {
+	if s.typ != single {
+		return false
+	}
+	switch s.c.typ {
+	case charDot:
+		return true
+	case charClass:
+		return s.c.cls.contains(r)
+	default:
+		return s.c.val == r
+	}
 }
 
-// getdfastate returns a dfa state for the corresponding list
-// of states. It first checks the cache, allocating a
-// new one if necessary.
-func getdfastate(list *[]*state) *dfastate {
-	d := cacheddfa[list]
-	if d != nil {
+// getdfastate returns a dfa state for the corresponding list of
+// states, keyed by the states themselves rather than by list's
+// backing array, so that the same powerset reached through a
+// different (or reused) scratch buffer still hits the cache. It first
+// checks the cache, copying list into a dfastate of its own otherwise.
+func getdfastate(list []*state, cache *DFACache) *dfastate {
+	key := keyFor(list)
+	if d := cache.get(key); d != nil {
 		return d
 	}
-	d = &dfastate{list: list}
-	cacheddfa[list] = d
+	owned := append([]*state(nil), list...)
+	d := &dfastate{list: owned}
+	cache.put(key, d)
 	return d
 }
 
@@ -211,7 +432,7 @@ func ismatch(list []*state) bool {
 func printnfa(s *state) {
 	fmt.Println(s)
 	switch s.typ {
-	case single:
+	case single, stypBOL, stypEOL, stypSave:
 		printnfa(s.out[0])
 	case split:
 		printnfa(s.out[1])
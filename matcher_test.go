@@ -0,0 +1,69 @@
+package matcher
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		expression string
+		source     string
+		want       bool
+	}{
+		{`abc`, `abc`, true},
+		{`abc`, `abd`, false},
+		{`a.c`, `a世c`, true},
+		{`é+`, `ééé`, true},
+		{`^abc$`, `abc`, true},
+		{`^abc$`, `xabc`, false},
+		{`a(b|c)*d`, `abcbcd`, true},
+		{`[a-z]+`, `hello`, true},
+		{`[a-z]+`, `HELLO`, false},
+		{`\d+`, `123`, true},
+		{`[^0-9]+`, `abc`, true},
+		{`[^0-9]+`, `a1c`, false},
+	}
+
+	for i, c := range cases {
+		chars, err := Lex(c.expression)
+		if err != nil {
+			t.Fatalf("case: %v, unexpected lex error: %v", i, err)
+		}
+		nfa := Post2nfa(Postfix(chars))
+		cache := NewDFACache(DefaultMaxDFAStates)
+		if got := Match(nfa, c.source, cache); got != c.want {
+			t.Fatalf("case: %v, Match(%q, %q) = %v, wanted: %v", i, c.expression, c.source, got, c.want)
+		}
+	}
+}
+
+// TestMatchConcurrent drives many goroutines through Match against a
+// single compiled NFA and a single shared DFACache, the pattern a
+// long-lived Regexp's cache is built for. Run with -race to catch
+// accidental mutation of shared NFA/dfastate bookkeeping.
+func TestMatchConcurrent(t *testing.T) {
+	chars, err := Lex(`a(b|c)*d`)
+	if err != nil {
+		t.Fatalf("unexpected lex error: %v", err)
+	}
+	nfa := Post2nfa(Postfix(chars))
+	cache := NewDFACache(DefaultMaxDFAStates)
+
+	sources := []string{"abcbcd", "ad", "abd", "xabcd", ""}
+	want := []bool{true, true, true, false, false}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 20; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, source := range sources {
+				if got := Match(nfa, source, cache); got != want[i] {
+					t.Errorf("Match(%q) = %v, wanted: %v", source, got, want[i])
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -7,10 +7,15 @@ import (
 )
 
 func match(regexp, source string) {
-	chars := matcher.Lex(regexp)
+	chars, err := matcher.Lex(regexp)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 	chars = matcher.Postfix(chars)
 	nfa := matcher.Post2nfa(chars)
-	fmt.Println(matcher.Match(nfa, source))
+	cache := matcher.NewDFACache(matcher.DefaultMaxDFAStates)
+	fmt.Println(matcher.Match(nfa, source, cache))
 }
 
 // START OMIT
@@ -8,7 +8,11 @@ import (
 
 // START OMIT
 func main() {
-	ch := matcher.Lex("abc")
+	ch, err := matcher.Lex("abc")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 	fmt.Println(matcher.Postfix(ch))
 }
 
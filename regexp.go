@@ -0,0 +1,376 @@
+package matcher
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// noPrefixByte marks a Regexp whose literal prefix (if any) doesn't
+// start with an ASCII byte, or has no literal prefix at all.
+const noPrefixByte = -1
+
+// Regexp is a compiled regular expression. A Regexp is safe to reuse
+// against any number of source strings once Compile has returned, and
+// safe for concurrent use by multiple goroutines.
+type Regexp struct {
+	expr       string
+	start      *state
+	ngroup     int       // number of explicit capture groups, not counting group 0
+	cache      *DFACache // memoizes MatchString's DFA across calls
+	prefixByte int       // first byte of a required literal prefix, or noPrefixByte
+}
+
+// String returns the source text used to compile re.
+func (re *Regexp) String() string {
+	return re.expr
+}
+
+// Compile parses expression and returns a compiled Regexp, or an
+// error if expression is malformed. See Lex for the possible errors.
+func Compile(expression string) (*Regexp, error) {
+	chars, err := Lex(expression)
+	if err != nil {
+		return nil, err
+	}
+	captured, ngroup := annotateCaptures(chars)
+	start := Post2nfa(Postfix(wrapGroup0(captured)))
+	prefixByte := noPrefixByte
+	if p := literalPrefix(start); p != "" && p[0] < utf8.RuneSelf {
+		prefixByte = int(p[0])
+	}
+	return &Regexp{
+		expr:       expression,
+		start:      start,
+		ngroup:     ngroup,
+		cache:      NewDFACache(DefaultMaxDFAStates),
+		prefixByte: prefixByte,
+	}, nil
+}
+
+// annotateCaptures returns a copy of chars with a charCapStart/charCapEnd
+// pair threaded around the contents of every group, numbered in the
+// order their '(' appears. This is a separate pass over Lex's output,
+// rather than something Lex itself emits, so that Lex, Postfix, and
+// Post2nfa stay exactly the pedagogical three-stage pipeline they
+// always were; Regexp is what turns that grouping syntax into capture
+// semantics.
+//
+// CapStart/CapEnd are glued to the group's contents with charConcat,
+// same as any other term, but Postfix's shunting-yard binds concat
+// tighter than a '|' already inside the group: without more, "(a|b)"
+// would be reduced as "(CapStart.a) | (b.CapEnd)", so only the branch
+// taken determines whether CapStart or CapEnd actually ran, and the
+// other slot is left at its -1 sentinel. Wrapping the original
+// contents in their own synthetic parens forces Postfix to fully
+// reduce them to one operand first, so CapStart and CapEnd end up
+// concatenated around the whole group regardless of what's inside it.
+func annotateCaptures(chars []char) ([]char, int) {
+	out := make([]char, 0, len(chars))
+	var stack []int
+	ngroup := 0
+	for _, c := range chars {
+		switch c.typ {
+		case charLparen:
+			ngroup++
+			stack = append(stack, ngroup)
+			out = append(out,
+				c,
+				char{typ: charCapStart, group: ngroup},
+				char{typ: charConcat, val: '.'},
+				char{typ: charLparen, val: '('},
+			)
+		case charRparen:
+			g := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			out = append(out,
+				char{typ: charRparen, val: ')'},
+				char{typ: charConcat, val: '.'},
+				char{typ: charCapEnd, group: g},
+				c,
+			)
+		default:
+			out = append(out, c)
+		}
+	}
+	return out, ngroup
+}
+
+// wrapGroup0 wraps chars in their own charCapStart/charCapEnd pair, as
+// group 0, so FindStringSubmatch can report the whole match alongside
+// any explicit submatches. As in annotateCaptures, chars go inside
+// synthetic parens so a top-level '|' can't split the pair apart.
+func wrapGroup0(chars []char) []char {
+	wrapped := make([]char, 0, len(chars)+6)
+	wrapped = append(wrapped, char{typ: charCapStart, group: 0}, char{typ: charConcat, val: '.'}, char{typ: charLparen, val: '('})
+	wrapped = append(wrapped, chars...)
+	wrapped = append(wrapped, char{typ: charRparen, val: ')'}, char{typ: charConcat, val: '.'}, char{typ: charCapEnd, group: 0})
+	return wrapped
+}
+
+// MatchString reports whether the regular expression matches the
+// entirety of s, not merely a substring of it: it reuses Match's
+// cached-DFA simulation as-is, since no submatch tracking is needed.
+// For substring search, use FindString or FindStringIndex.
+func (re *Regexp) MatchString(s string) bool {
+	return Match(re.start, s, re.cache)
+}
+
+// FindString returns the leftmost match of the regular expression in
+// s, or "" if there is no match.
+func (re *Regexp) FindString(s string) string {
+	m := re.nextMatch(s, 0)
+	if m == nil {
+		return ""
+	}
+	return s[m[0]:m[1]]
+}
+
+// FindStringIndex returns a two-element slice holding the byte
+// indexes of the leftmost match in s, or nil if there is no match.
+func (re *Regexp) FindStringIndex(s string) []int {
+	m := re.nextMatch(s, 0)
+	if m == nil {
+		return nil
+	}
+	return []int{m[0], m[1]}
+}
+
+// FindStringSubmatch returns a slice holding the text of the leftmost
+// match and the text of each explicit capture group, indexed the same
+// way as Go's regexp package: index 0 is the whole match, and a group
+// that did not participate in the match is "". It returns nil if
+// there is no match.
+func (re *Regexp) FindStringSubmatch(s string) []string {
+	m := re.nextMatch(s, 0)
+	if m == nil {
+		return nil
+	}
+	out := make([]string, re.ngroup+1)
+	for g := 0; g <= re.ngroup; g++ {
+		lo, hi := m[2*g], m[2*g+1]
+		if lo >= 0 && hi >= 0 {
+			out[g] = s[lo:hi]
+		}
+	}
+	return out
+}
+
+// FindAllString returns all successive, non-overlapping matches of
+// the regular expression in s, or nil if there is no match.
+func (re *Regexp) FindAllString(s string) []string {
+	var out []string
+	prevEnd := -1
+	for start := 0; start <= len(s); {
+		m := re.nextMatch(s, start)
+		if m == nil {
+			break
+		}
+		if m[0] == m[1] && m[0] == prevEnd {
+			// A zero-width match butted right up against the end of
+			// the previous match isn't a distinct match (standard
+			// regex semantics, and what Go's own regexp does): skip
+			// it instead of reporting a phantom "" between every pair
+			// of real matches.
+			start = advancePast(s, start, m[1])
+			continue
+		}
+		out = append(out, s[m[0]:m[1]])
+		prevEnd = m[1]
+		start = advancePast(s, start, m[1])
+	}
+	return out
+}
+
+// ReplaceAllString returns a copy of src with each non-overlapping
+// match of the regular expression replaced by repl.
+func (re *Regexp) ReplaceAllString(src, repl string) string {
+	return re.ReplaceAllStringFunc(src, func(string) string { return repl })
+}
+
+// ReplaceAllStringFunc returns a copy of src with each non-overlapping
+// match of the regular expression replaced by the return value of
+// repl, called with the matched text.
+func (re *Regexp) ReplaceAllStringFunc(src string, repl func(string) string) string {
+	var b strings.Builder
+	start := 0
+	prevEnd := -1
+	for start <= len(src) {
+		m := re.nextMatch(src, start)
+		if m == nil {
+			break
+		}
+		if m[0] == m[1] && m[0] == prevEnd {
+			// See the identical check in FindAllString: a zero-width
+			// match immediately after the previous one is not a
+			// distinct match, so copy the rune it would have skipped
+			// over through untouched instead of calling repl on "".
+			next := advancePast(src, start, m[1])
+			writeEnd := next
+			if writeEnd > len(src) {
+				writeEnd = len(src)
+			}
+			if writeEnd > start {
+				b.WriteString(src[start:writeEnd])
+			}
+			start = next
+			continue
+		}
+		b.WriteString(src[start:m[0]])
+		b.WriteString(repl(src[m[0]:m[1]]))
+		prevEnd = m[1]
+		next := advancePast(src, start, m[1])
+		// next can run one past len(src) (advancePast's sentinel for
+		// "step past a zero-width match at end-of-string so the loop
+		// terminates"), which must never be used as a slice bound.
+		writeEnd := next
+		if writeEnd > len(src) {
+			writeEnd = len(src)
+		}
+		if writeEnd > m[1] {
+			b.WriteString(src[m[1]:writeEnd])
+		}
+		start = next
+	}
+	if start < len(src) {
+		b.WriteString(src[start:])
+	}
+	return b.String()
+}
+
+// advancePast returns the offset to resume searching src from after a
+// match ending at end that started searching at start: end itself,
+// unless the match was zero-width, in which case it steps past one
+// rune so the caller doesn't loop forever re-matching the empty
+// string at the same position.
+func advancePast(src string, start, end int) int {
+	if end > start {
+		return end
+	}
+	if end >= len(src) {
+		return end + 1
+	}
+	_, size := utf8.DecodeRuneInString(src[end:])
+	return end + size
+}
+
+// thread is a single execution thread in the submatch-tracking NFA
+// simulation: a state together with the capture slots saved by the
+// path that reached it.
+type thread struct {
+	s     *state
+	saved []int
+}
+
+// addthread adds s to the thread list, following any zero-width
+// states (split, stypBOL, stypEOL, stypSave) along the way. It
+// mirrors addstate, but carries the thread's saved capture slots
+// through split, copying them at every stypSave so that sibling
+// threads don't share backing arrays. visited and gen are the
+// caller's own per-call dedup bookkeeping (see addstate), so that two
+// goroutines running submatchAt against the same compiled pattern at
+// the same time never touch shared NFA state.
+func addthread(list *[]thread, s *state, saved []int, visited []int, gen, pos int, atBOL, atEOL bool) {
+	if visited[s.id] == gen {
+		return
+	}
+	visited[s.id] = gen
+	switch s.typ {
+	case split:
+		addthread(list, s.out[0], saved, visited, gen, pos, atBOL, atEOL)
+		addthread(list, s.out[1], saved, visited, gen, pos, atBOL, atEOL)
+		return
+	case stypBOL:
+		if atBOL {
+			addthread(list, s.out[0], saved, visited, gen, pos, atBOL, atEOL)
+		}
+		return
+	case stypEOL:
+		if atEOL {
+			addthread(list, s.out[0], saved, visited, gen, pos, atBOL, atEOL)
+		}
+		return
+	case stypSave:
+		nsaved := append([]int(nil), saved...)
+		nsaved[s.slot] = pos
+		addthread(list, s.out[0], nsaved, visited, gen, pos, atBOL, atEOL)
+		return
+	}
+	*list = append(*list, thread{s: s, saved: saved})
+}
+
+// nextMatch returns the saved capture slots of the leftmost match in
+// source starting at or after the byte offset from, trying successive
+// starting offsets since submatchAt only ever matches a prefix
+// beginning exactly where it is seeded. It returns nil if no match
+// starts anywhere at or after from. When re has a literal prefix that
+// starts with an ASCII byte, candidate starting offsets are found by
+// searching for that byte with strings.IndexByte instead of being
+// tried one rune at a time.
+func (re *Regexp) nextMatch(source string, from int) []int {
+	for start := from; ; {
+		if re.prefixByte != noPrefixByte {
+			if start > len(source) {
+				return nil
+			}
+			idx := strings.IndexByte(source[start:], byte(re.prefixByte))
+			if idx < 0 {
+				return nil
+			}
+			start += idx
+		}
+		if m := re.submatchAt(source, start); m != nil {
+			return m
+		}
+		if start >= len(source) {
+			return nil
+		}
+		_, size := utf8.DecodeRuneInString(source[start:])
+		start += size
+	}
+}
+
+// submatchAt runs the plain (cache-free) NFA simulation seeded at
+// byte offset start in source, recovering capture positions that the
+// DFA cache in Match has no way to track per-thread. It returns the
+// saved slot positions of the highest-priority match found, or nil if
+// no match begins at start.
+func (re *Regexp) submatchAt(source string, start int) []int {
+	saved := make([]int, 2*(re.ngroup+1))
+	for i := range saved {
+		saved[i] = -1
+	}
+
+	nstates := re.cache.statesFor(re.start)
+	visited := make([]int, nstates+1)
+	gen := 1
+	list := []thread{}
+	addthread(&list, re.start, saved, visited, gen, start, start == 0, start == len(source))
+
+	var matched []int
+	for i := start; ; {
+		atEOL := i == len(source)
+		var r rune
+		var size int
+		if !atEOL {
+			r, size = utf8.DecodeRuneInString(source[i:])
+		}
+
+		nlist := []thread{}
+		gen++
+		for _, th := range list {
+			if th.s.typ == match {
+				matched = th.saved
+				break
+			}
+			if !atEOL && matchesChar(th.s, r) {
+				addthread(&nlist, th.s.out[0], th.saved, visited, gen, i+size, false, i+size == len(source))
+			}
+		}
+		if atEOL {
+			break
+		}
+		list = nlist
+		i += size
+	}
+	return matched
+}
@@ -0,0 +1,165 @@
+package matcher
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegexpMatchString(t *testing.T) {
+	cases := []struct {
+		expression string
+		source     string
+		want       bool
+	}{
+		{`abc`, `abc`, true},
+		{`abc`, `xabcx`, false}, // MatchString requires a full match, not a substring
+		{`a(b|c)*d`, `abcbcd`, true},
+	}
+
+	for i, c := range cases {
+		re, err := Compile(c.expression)
+		if err != nil {
+			t.Fatalf("case: %v, unexpected compile error: %v", i, err)
+		}
+		if got := re.MatchString(c.source); got != c.want {
+			t.Fatalf("case: %v, MatchString(%q, %q) = %v, wanted: %v", i, c.expression, c.source, got, c.want)
+		}
+	}
+}
+
+func TestRegexpFind(t *testing.T) {
+	cases := []struct {
+		expression string
+		source     string
+		find       string
+		findIndex  []int
+		submatch   []string
+	}{
+		{`a+`, `xxaaaxx`, `aaa`, []int{2, 5}, []string{`aaa`}},
+		{`(a)(b)`, `xabx`, `ab`, []int{1, 3}, []string{`ab`, `a`, `b`}},
+		{`(a+)(b?)`, `caab`, `aab`, []int{1, 4}, []string{`aab`, `aa`, `b`}},
+		{`z+`, `abc`, ``, nil, nil},
+		// Regression: a capture group whose direct content is a
+		// top-level alternation must save both slots regardless of
+		// which branch matched.
+		{`(cat|dog)`, `dog`, `dog`, []int{0, 3}, []string{`dog`, `dog`}},
+		{`(a|x)(b|c)`, `ab`, `ab`, []int{0, 2}, []string{`ab`, `a`, `b`}},
+		{`(x|yz)(p|q)`, `yzq`, `yzq`, []int{0, 3}, []string{`yzq`, `yz`, `q`}},
+	}
+
+	for i, c := range cases {
+		re, err := Compile(c.expression)
+		if err != nil {
+			t.Fatalf("case: %v, unexpected compile error: %v", i, err)
+		}
+		if got := re.FindString(c.source); got != c.find {
+			t.Fatalf("case: %v, FindString(%q) = %q, wanted: %q", i, c.source, got, c.find)
+		}
+		if got := re.FindStringIndex(c.source); !reflect.DeepEqual(got, c.findIndex) {
+			t.Fatalf("case: %v, FindStringIndex(%q) = %v, wanted: %v", i, c.source, got, c.findIndex)
+		}
+		if got := re.FindStringSubmatch(c.source); !reflect.DeepEqual(got, c.submatch) {
+			t.Fatalf("case: %v, FindStringSubmatch(%q) = %v, wanted: %v", i, c.source, got, c.submatch)
+		}
+	}
+}
+
+func TestRegexpFindAllString(t *testing.T) {
+	re, err := Compile(`a+`)
+	if err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+	got := re.FindAllString(`aa xa aaa`)
+	want := []string{`aa`, `a`, `aaa`}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("FindAllString = %v, wanted: %v", got, want)
+	}
+}
+
+// TestRegexpFindAllStringSuppressesAdjacentZeroWidth guards against a
+// zero-width match immediately following a non-empty match being
+// reported as a distinct match: standard regex semantics (and Go's
+// own regexp) treat it as the same position already covered.
+func TestRegexpFindAllStringSuppressesAdjacentZeroWidth(t *testing.T) {
+	re, err := Compile(`x*`)
+	if err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+	got := re.FindAllString(`axbxxc`)
+	want := []string{``, `x`, `xx`, ``}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("FindAllString = %v, wanted: %v", got, want)
+	}
+}
+
+func TestRegexpReplaceAllString(t *testing.T) {
+	re, err := Compile(`[0-9]+`)
+	if err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+	got := re.ReplaceAllString(`room 12, row 4`, `#`)
+	want := `room #, row #`
+	if got != want {
+		t.Fatalf("ReplaceAllString = %q, wanted: %q", got, want)
+	}
+}
+
+// TestRegexpReplaceAllStringSuppressesAdjacentZeroWidth is the
+// ReplaceAllString analog of
+// TestRegexpFindAllStringSuppressesAdjacentZeroWidth: a zero-width
+// match right after a non-empty one must not contribute another
+// (empty) replacement.
+func TestRegexpReplaceAllStringSuppressesAdjacentZeroWidth(t *testing.T) {
+	re, err := Compile(`x*`)
+	if err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+	got := re.ReplaceAllString(`axbxxc`, `-`)
+	want := `-a-b-c-`
+	if got != want {
+		t.Fatalf("ReplaceAllString = %q, wanted: %q", got, want)
+	}
+}
+
+// TestRegexpReplaceAllStringZeroWidthAtEnd guards against a panic when
+// a zero-width match lands exactly at the end of src: advancePast
+// steps one past len(src) so the search loop terminates, and that
+// sentinel must never be used to slice src.
+func TestRegexpReplaceAllStringZeroWidthAtEnd(t *testing.T) {
+	re, err := Compile(`x*`)
+	if err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+	got := re.ReplaceAllString(`y`, `Z`)
+	want := `ZyZ`
+	if got != want {
+		t.Fatalf("ReplaceAllString = %q, wanted: %q", got, want)
+	}
+}
+
+// TestRegexpBracketedNegatedPerlClassMatchesNonASCII guards against
+// [\D], [\W], and [\S] disagreeing with their un-bracketed forms on
+// runes above the ASCII bitmap: merging a negated Perl class into a
+// bracket expression must negate over all of Unicode, not just 0-255.
+func TestRegexpBracketedNegatedPerlClassMatchesNonASCII(t *testing.T) {
+	cases := []struct {
+		expression string
+		source     string
+	}{
+		{`\D`, "あ"},
+		{`[\D]`, "あ"},
+		{`\W`, "あ"},
+		{`[\W]`, "あ"},
+		{`\S`, "あ"},
+		{`[\S]`, "あ"},
+	}
+	for i, c := range cases {
+		re, err := Compile(c.expression)
+		if err != nil {
+			t.Fatalf("case: %v, unexpected compile error: %v", i, err)
+		}
+		if !re.MatchString(c.source) {
+			t.Fatalf("case: %v, MatchString(%q, %q) = false, wanted: true", i, c.expression, c.source)
+		}
+	}
+}